@@ -15,13 +15,78 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"runtime"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 )
 
+// errNoTty is returned by Resize when the process was not started with Tty
+var errNoTty = errors.New("cmd: process was not started with a tty")
+
+// defaultGraceTimeout is how long StartContext waits after the graceful
+// shutdown signal before escalating to Kill
+const defaultGraceTimeout = 10 * time.Second
+
+// DedupEnv returns env with duplicate keys removed, keeping only the last
+// occurrence of each key.  Every other entry, including duplicates of
+// opaque entries that don't look like KEY=VALUE, keeps its original
+// position; an entry's key effectively "moves" to wherever its last
+// occurrence was because the earlier duplicates are the ones dropped.
+// When caseInsensitive is true, keys are folded for comparison, but the
+// surviving entry keeps its original casing; this also keeps Windows's
+// special leading-= drive entries, like "=C:=C:\foo", as valid keyed
+// entries rather than discarding them as malformed
+func DedupEnv(env []string, caseInsensitive bool) []string {
+	seen := make(map[string]bool, len(env))
+	result := make([]string, 0, len(env))
+
+	for i := len(env) - 1; i >= 0; i-- {
+		kv := env[i]
+		if key, ok := envKey(kv); ok {
+			if caseInsensitive {
+				key = strings.ToUpper(key)
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		result = append(result, kv)
+	}
+
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result
+}
+
+// envKey returns the KEY portion of a KEY=VALUE environment entry.  It
+// returns false for opaque entries with no '=' at all, and it handles
+// Windows's special per-drive entries whose key itself starts with '=' by
+// looking past the leading '=' for the real separator
+func envKey(kv string) (string, bool) {
+	idx := strings.IndexByte(kv, '=')
+	if idx < 0 {
+		return "", false
+	}
+	if idx == 0 {
+		next := strings.IndexByte(kv[1:], '=')
+		if next < 0 {
+			return "", false
+		}
+		idx = next + 1
+	}
+	return kv[:idx], true
+}
+
 // Process is an instance of a command.  A process is not initially
 // running and must be started by means of the Start function
 type Process interface {
@@ -33,10 +98,22 @@ type Process interface {
 	// does not wait for the process to complete
 	Start() error
 
+	// StartContext behaves like Start except that cancelling ctx triggers a
+	// graceful Shutdown of the process using the default signal and grace
+	// period
+	StartContext(ctx context.Context) error
+
 	// Kill attempts to kill the underlying OS process.  This may or may not be implemented
 	// on all operating systems
 	Kill() error
 
+	// Signal sends signal to the underlying OS process
+	Signal(signal os.Signal) error
+
+	// Shutdown sends signal to the process and waits up to grace for it to
+	// exit on its own before escalating to Kill
+	Shutdown(signal os.Signal, grace time.Duration) error
+
 	// Wait will wait for the underlying process to complete.  Wait will not return until
 	// the OS process has either finished on its own or has been killed
 	Wait() error
@@ -53,6 +130,22 @@ type Process interface {
 	// data that the process writes to Stderr.  This is implemented with an underlying
 	// multi-writer
 	Stderr(io.Writer)
+
+	// Tty requests that the process run attached to pty instead of the usual
+	// stdio pipes.  pty's slave becomes the child's Stdin/Stdout/Stderr and its
+	// master is fanned into Stdout the same way a pipe would be.  Tty must be
+	// called before Start
+	Tty(pty *PTY) error
+
+	// Resize forwards the given window size to the process's pty.  Resize
+	// returns an error if the process was not started with Tty
+	Resize(rows, cols uint16) error
+
+	// Env appends instance specific environment variables to the process,
+	// overriding any matching keys from the Command or the OS environment.
+	// This allows adding instance specific variables the same way
+	// AppendArgs does for arguments
+	Env(kv ...string)
 }
 
 type process struct {
@@ -60,6 +153,14 @@ type process struct {
 	stderr multiWriter
 	stdout multiWriter
 	args   []string
+	pty    *PTY
+	ctx    context.Context
+	env    []string
+
+	waitOnce sync.Once
+	waitErr  error
+	finished chan struct{}
+	copyWg   sync.WaitGroup
 }
 
 func (proc *process) AppendArgs(args ...string) {
@@ -78,15 +179,52 @@ func (proc *process) String() string {
 }
 
 func (proc *process) Start() error {
+	err := proc.start()
+	if err == nil && proc.ctx != nil {
+		proc.watch(proc.ctx)
+	}
+	return err
+}
+
+func (proc *process) StartContext(ctx context.Context) error {
+	err := proc.start()
+	if err == nil {
+		proc.watch(ctx)
+	}
+	return err
+}
+
+// watch spawns a goroutine that shuts the process down gracefully as soon
+// as ctx is cancelled, and exits on its own once the process finishes
+func (proc *process) watch(ctx context.Context) {
+	go func() {
+		select {
+		case <-ctx.Done():
+			proc.Shutdown(defaultShutdownSignal, defaultGraceTimeout)
+		case <-proc.finished:
+		}
+	}()
+}
+
+func (proc *process) start() error {
 	proc.cmd.Args = append(proc.cmd.Args, proc.args...)
+
+	if len(proc.env) > 0 {
+		proc.cmd.Env = DedupEnv(append(os.Environ(), proc.env...), runtime.GOOS == "windows")
+	}
+
+	if proc.pty != nil {
+		return proc.startTty()
+	}
+
 	stderr, err := proc.cmd.StderrPipe()
 	if err == nil {
-		go proc.stderr.copy(stderr)
+		proc.goCopy(proc.stderr.copy, stderr)
 
 		var stdout io.Reader
 		stdout, err = proc.cmd.StdoutPipe()
 		if err == nil {
-			go proc.stdout.copy(stdout)
+			proc.goCopy(proc.stdout.copy, stdout)
 		}
 	}
 
@@ -96,12 +234,93 @@ func (proc *process) Start() error {
 	return err
 }
 
+func (proc *process) startTty() error {
+	proc.cmd.Stdin = proc.pty.Slave
+	proc.cmd.Stdout = proc.pty.Slave
+	proc.cmd.Stderr = proc.pty.Slave
+
+	if proc.cmd.SysProcAttr == nil {
+		proc.cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	setCtty(proc.cmd.SysProcAttr, 0)
+
+	err := proc.cmd.Start()
+	if err == nil {
+		proc.pty.Slave.Close()
+		proc.goCopy(proc.stdout.copy, proc.pty.Master)
+	}
+	return err
+}
+
+// goCopy runs copy in its own goroutine, tracking it in copyWg so Wait can
+// block until the pipe has been fully drained into the multiWriter.
+// Wait must not return until every reader spawned by start/startTty has
+// finished, or callers can observe incomplete Stdout/Stderr right after
+// Wait returns
+func (proc *process) goCopy(copy func(io.Reader) error, reader io.Reader) {
+	proc.copyWg.Add(1)
+	go func() {
+		defer proc.copyWg.Done()
+		copy(reader)
+	}()
+}
+
+func (proc *process) Tty(pty *PTY) error {
+	proc.pty = pty
+	return nil
+}
+
+func (proc *process) Resize(rows, cols uint16) error {
+	if proc.pty == nil {
+		return errNoTty
+	}
+	return proc.pty.Resize(rows, cols)
+}
+
+func (proc *process) Env(kv ...string) {
+	proc.env = append(proc.env, kv...)
+}
+
 func (proc *process) Kill() error {
 	return proc.cmd.Process.Kill()
 }
 
 func (proc *process) Wait() error {
-	return proc.cmd.Wait()
+	proc.waitOnce.Do(func() {
+		// The copy goroutines see EOF on their own once the child exits and
+		// closes its end of the pipe, so draining them doesn't require the
+		// child to have been reaped yet.  They must be drained before
+		// cmd.Wait() is called: StdoutPipe/StderrPipe's read end is closed
+		// by cmd.Wait() once it reaps the process, and reading from an
+		// already-closed pipe truncates whatever hadn't been copied yet
+		proc.copyWg.Wait()
+		proc.waitErr = proc.cmd.Wait()
+		close(proc.finished)
+	})
+	return proc.waitErr
+}
+
+func (proc *process) Signal(signal os.Signal) error {
+	return proc.cmd.Process.Signal(signal)
+}
+
+func (proc *process) Shutdown(signal os.Signal, grace time.Duration) error {
+	if err := proc.Signal(signal); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- proc.Wait() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(grace):
+		if err := proc.Kill(); err != nil {
+			return err
+		}
+		return <-done
+	}
 }
 
 func (proc *process) Stdin(reader io.Reader) {
@@ -128,11 +347,25 @@ type Command interface {
 	// Process creates a new process with the command and its arguments.  The
 	// returned Process will not yet be started
 	Process() Process
+
+	// Environ returns the environment variables that will be added to every
+	// process created for this command, on top of the OS environment.
+	// Named Environ rather than Env so TestCmd can expose its variables as
+	// a plain Env field instead of a method of the same name
+	Environ() []string
+
+	// SetEnv replaces the command's environment variables outright
+	SetEnv(env []string)
+
+	// AppendEnv appends kv to the command's environment variables
+	AppendEnv(kv ...string)
 }
 
 type cmd struct {
 	path string
 	args []string
+	ctx  context.Context
+	env  []string
 }
 
 // New will create a new command for the given path and argument list.
@@ -140,15 +373,29 @@ type cmd struct {
 // is created for this command.  Each Process can be customized by calling
 // the AppendArguments function
 func New(path string, args ...string) Command {
-	return &cmd{path, args}
+	return &cmd{path: path, args: args}
+}
+
+// NewContext behaves like New except that every Process it creates is
+// automatically started with StartContext(ctx), so cancelling ctx triggers
+// a graceful shutdown of the running process
+func NewContext(ctx context.Context, path string, args ...string) Command {
+	return &cmd{path: path, args: args, ctx: ctx}
 }
 
 func (cmd *cmd) Path() string        { return cmd.path }
 func (cmd *cmd) SetPath(path string) { cmd.path = path }
 
+func (cmd *cmd) Environ() []string      { return cmd.env }
+func (cmd *cmd) SetEnv(env []string)    { cmd.env = env }
+func (cmd *cmd) AppendEnv(kv ...string) { cmd.env = append(cmd.env, kv...) }
+
 func (cmd *cmd) Process() Process {
 	return &process{
-		cmd: exec.Command(cmd.path, cmd.args...),
+		cmd:      exec.Command(cmd.path, cmd.args...),
+		ctx:      cmd.ctx,
+		env:      append([]string(nil), cmd.env...),
+		finished: make(chan struct{}),
 	}
 }
 
@@ -164,9 +411,16 @@ type testProcess struct {
 
 	wg sync.WaitGroup
 
-	startErr error
-	waitErr  error
-	killErr  error
+	startErr    error
+	waitErr     error
+	killErr     error
+	signalErr   error
+	shutdownErr error
+
+	mu      sync.Mutex
+	signals []os.Signal
+
+	env []string
 }
 
 func (tp *testProcess) AppendArgs(args ...string) {}
@@ -193,6 +447,22 @@ func (tp *testProcess) Start() error {
 	return tp.startErr
 }
 
+func (tp *testProcess) StartContext(ctx context.Context) error {
+	err := tp.Start()
+	if err == nil {
+		finished := make(chan struct{})
+		go func() { tp.wg.Wait(); close(finished) }()
+		go func() {
+			select {
+			case <-ctx.Done():
+				tp.Shutdown(defaultShutdownSignal, defaultGraceTimeout)
+			case <-finished:
+			}
+		}()
+	}
+	return err
+}
+
 func (tp *testProcess) Kill() error { return tp.killErr }
 
 func (tp *testProcess) Wait() error {
@@ -200,10 +470,29 @@ func (tp *testProcess) Wait() error {
 	return tp.waitErr
 }
 
+func (tp *testProcess) Signal(signal os.Signal) error {
+	tp.mu.Lock()
+	tp.signals = append(tp.signals, signal)
+	tp.mu.Unlock()
+	return tp.signalErr
+}
+
+func (tp *testProcess) Shutdown(signal os.Signal, grace time.Duration) error {
+	if err := tp.Signal(signal); err != nil {
+		return err
+	}
+	return tp.shutdownErr
+}
+
 func (tp *testProcess) Stdin(reader io.Reader)  { tp.stdinReader = reader }
 func (tp *testProcess) Stdout(writer io.Writer) { tp.stdoutWriter.add(writer) }
 func (tp *testProcess) Stderr(writer io.Writer) { tp.stderrWriter.add(writer) }
 
+func (tp *testProcess) Tty(pty *PTY) error             { return nil }
+func (tp *testProcess) Resize(rows, cols uint16) error { return nil }
+
+func (tp *testProcess) Env(kv ...string) { tp.env = append(tp.env, kv...) }
+
 // TestCmd is useful for mocking commands without actually executing
 // anything
 type TestCmd struct {
@@ -221,6 +510,16 @@ type TestCmd struct {
 
 	// KillErr is returned by the Process' Kill function
 	KillErr error
+
+	// SignalErr is returned by the Process' Signal function
+	SignalErr error
+
+	// ShutdownErr is returned by the Process' Shutdown function
+	ShutdownErr error
+
+	// Env is the environment variables that will be added to every
+	// Process created by this TestCmd
+	Env []string
 }
 
 // Process creates a test process that will behave according to
@@ -228,11 +527,14 @@ type TestCmd struct {
 // TestCmd
 func (tc *TestCmd) Process() Process {
 	return &testProcess{
-		stdout:   tc.Stdout,
-		stderr:   tc.Stderr,
-		startErr: tc.StartErr,
-		waitErr:  tc.WaitErr,
-		killErr:  tc.KillErr,
+		stdout:      tc.Stdout,
+		stderr:      tc.Stderr,
+		startErr:    tc.StartErr,
+		waitErr:     tc.WaitErr,
+		killErr:     tc.KillErr,
+		signalErr:   tc.SignalErr,
+		shutdownErr: tc.ShutdownErr,
+		env:         append([]string(nil), tc.Env...),
 	}
 }
 
@@ -241,3 +543,12 @@ func (*TestCmd) Path() string { return "" }
 
 // SetPath does nothing for TestCmds
 func (*TestCmd) SetPath(string) {}
+
+// Environ returns tc.Env
+func (tc *TestCmd) Environ() []string { return tc.Env }
+
+// SetEnv replaces tc.Env outright
+func (tc *TestCmd) SetEnv(env []string) { tc.Env = env }
+
+// AppendEnv appends kv to tc.Env
+func (tc *TestCmd) AppendEnv(kv ...string) { tc.Env = append(tc.Env, kv...) }
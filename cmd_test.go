@@ -16,9 +16,7 @@ package cmd
 
 import (
 	"bytes"
-	"fmt"
 	"io"
-	"os"
 	"testing"
 )
 
@@ -38,51 +36,6 @@ func TestProcessAppendArgs(t *testing.T) {
 	}
 }
 
-func TestCommandStart(t *testing.T) {
-	cmd := New("")
-	wantStderr := "Re-elect Mayor Red Thomas. Progress is his middle name"
-	wantStdout := "I'll be the most powerful man in Hill Valley and I'm gonna clean up this town!"
-
-	stderr := bytes.NewBuffer(nil)
-	stdout := bytes.NewBuffer(nil)
-
-	cmd.SetPath(os.Args[0])
-	proc := cmd.Process()
-	proc.(*process).cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1", fmt.Sprintf("STDERR=%s", wantStderr), fmt.Sprintf("STDOUT=%s", wantStdout)}
-	proc.AppendArgs("-test.run=TestHelperProcess", "--")
-	proc.Stderr(stderr)
-	proc.Stdout(stdout)
-
-	err := proc.Start()
-	if err == nil {
-		err = proc.Wait()
-	}
-
-	if err == nil {
-		gotStderr := string(stderr.Bytes())
-		if gotStderr != wantStderr {
-			t.Errorf("want %q got %q", wantStderr, gotStderr)
-		}
-
-		gotStdout := string(stdout.Bytes())
-		if gotStdout != wantStdout {
-			t.Errorf("want %q got %q", wantStdout, gotStdout)
-		}
-	} else {
-		t.Errorf("Unexpected error: %v", err)
-	}
-
-}
-
-func TestHelperProcess(t *testing.T) {
-	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
-		return
-	}
-	fmt.Fprintf(os.Stdout, "%s", os.Getenv("STDOUT"))
-	fmt.Fprintf(os.Stderr, "%s", os.Getenv("STDERR"))
-	os.Exit(0)
-}
-
 func TestTestCommand(t *testing.T) {
 	wantStdout := "Humback... people?"
 	wantStderr := "Whales, Mr. Scott, Whales"
@@ -0,0 +1,123 @@
+// Copyright 2019 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmdtest provides a reusable harness for tests that need to
+// re-exec the test binary as a helper process, replacing the old pattern
+// of hijacking a Test* function behind a GO_WANT_HELPER_PROCESS style
+// environment variable check.  Callers invoke Main from their own TestMain,
+// register helpers (either at init time with Register, or inline via the
+// map passed to Main), and obtain a Command that re-execs the test binary
+// into a given helper with HelperCommand
+package cmdtest
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/mh-orange/cmd"
+)
+
+// EnvHelper is the environment variable Main and HelperCommand use to tell
+// a re-exec'd test binary which registered helper to run
+const EnvHelper = "CMD_TEST_HELPER"
+
+var (
+	mu      sync.Mutex
+	helpers = map[string]func(args []string) int{}
+	used    = map[string]bool{}
+)
+
+// Register records a helper under name for package init time registration.
+// Main fails the suite if a registered helper is never exercised by
+// HelperCommand, so dead helpers get flagged
+func Register(name string, fn func(args []string) int) {
+	mu.Lock()
+	defer mu.Unlock()
+	helpers[name] = fn
+}
+
+// Main should be called from a test binary's own TestMain.  If the
+// environment indicates this process was re-exec'd as a helper, Main
+// dispatches to the matching helper - checked first in helperMap, then in
+// the helpers registered with Register - writes directly to the real
+// os.Stdout/os.Stderr, and exits with the helper's return code.  Otherwise
+// Main runs m.Run(), and additionally fails the suite if any helper
+// registered with Register was never exercised
+func Main(m *testing.M, helperMap map[string]func(args []string) int) {
+	if name := os.Getenv(EnvHelper); name != "" {
+		fn, ok := helperMap[name]
+		if !ok {
+			mu.Lock()
+			fn, ok = helpers[name]
+			mu.Unlock()
+		}
+
+		if !ok {
+			fmt.Fprintf(os.Stderr, "cmdtest: no helper registered for %q\n", name)
+			os.Exit(2)
+		}
+		os.Exit(fn(os.Args[1:]))
+	}
+
+	code := m.Run()
+
+	mu.Lock()
+	unused := unusedHelpers(helpers, used)
+	mu.Unlock()
+
+	for _, name := range unused {
+		fmt.Fprintf(os.Stderr, "cmdtest: helper %q was registered but never used by a HelperCommand\n", name)
+		code = 1
+	}
+
+	os.Exit(code)
+}
+
+// unusedHelpers returns the names registered in helpers that are not marked
+// used, sorted for deterministic output. It is split out of Main so the
+// guardrail can be exercised directly in tests without spawning a helper
+// process
+func unusedHelpers(helpers map[string]func(args []string) int, used map[string]bool) []string {
+	var names []string
+	for name := range helpers {
+		if !used[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HelperCommand returns a Command that re-execs the current test binary
+// with the environment set so that Main dispatches to the helper
+// registered under name.  args become the helper's arguments
+func HelperCommand(t *testing.T, name string, args ...string) cmd.Command {
+	t.Helper()
+
+	mu.Lock()
+	used[name] = true
+	mu.Unlock()
+
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	command := cmd.New(self, args...)
+	command.AppendEnv(EnvHelper + "=" + name)
+	return command
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmdtest
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	Register("echo", func(args []string) int {
+		fmt.Fprint(os.Stdout, args[0])
+		return 0
+	})
+	Main(m, nil)
+}
+
+func TestHelperCommand(t *testing.T) {
+	command := HelperCommand(t, "echo", "hello from the helper")
+	proc := command.Process()
+
+	out := bytes.NewBuffer(nil)
+	proc.Stdout(out)
+
+	if err := proc.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := proc.Wait(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if want, got := "hello from the helper", out.String(); want != got {
+		t.Errorf("want %q got %q", want, got)
+	}
+}
+
+// TestUnusedHelpers exercises the guardrail Main uses to fail the suite when
+// a registered helper is never exercised by HelperCommand, without actually
+// spawning a helper process
+func TestUnusedHelpers(t *testing.T) {
+	helpers := map[string]func(args []string) int{
+		"a": nil,
+		"b": nil,
+		"c": nil,
+	}
+	used := map[string]bool{
+		"a": true,
+		"c": true,
+	}
+
+	want := []string{"b"}
+	if got := unusedHelpers(helpers, used); !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v got %v", want, got)
+	}
+
+	used["b"] = true
+	if got := unusedHelpers(helpers, used); len(got) != 0 {
+		t.Errorf("want no unused helpers, got %v", got)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/mh-orange/cmd/cmdtest"
+)
+
+func TestMain(m *testing.M) {
+	cmdtest.Register("marty", func(args []string) int {
+		fmt.Fprint(os.Stdout, os.Getenv("STDOUT"))
+		fmt.Fprint(os.Stderr, os.Getenv("STDERR"))
+		return 0
+	})
+	cmdtest.Main(m, nil)
+}
+
+// TestCommandStart is the reference example for cmdtest: it re-execs this
+// test binary into the "marty" helper instead of hijacking a Test* function
+// behind a GO_WANT_HELPER_PROCESS style environment check
+func TestCommandStart(t *testing.T) {
+	wantStderr := "Re-elect Mayor Red Thomas. Progress is his middle name"
+	wantStdout := "I'll be the most powerful man in Hill Valley and I'm gonna clean up this town!"
+
+	os.Setenv("STDOUT", wantStdout)
+	os.Setenv("STDERR", wantStderr)
+	defer os.Unsetenv("STDOUT")
+	defer os.Unsetenv("STDERR")
+
+	command := cmdtest.HelperCommand(t, "marty")
+	proc := command.Process()
+
+	stderr := bytes.NewBuffer(nil)
+	stdout := bytes.NewBuffer(nil)
+	proc.Stderr(stderr)
+	proc.Stdout(stdout)
+
+	err := proc.Start()
+	if err == nil {
+		err = proc.Wait()
+	}
+
+	if err == nil {
+		if gotStderr := stderr.String(); gotStderr != wantStderr {
+			t.Errorf("want %q got %q", wantStderr, gotStderr)
+		}
+
+		if gotStdout := stdout.String(); gotStdout != wantStdout {
+			t.Errorf("want %q got %q", wantStdout, gotStdout)
+		}
+	} else {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
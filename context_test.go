@@ -0,0 +1,69 @@
+// Copyright 2019 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestStartContextShutsDownOnCancel(t *testing.T) {
+	cmd := New("sleep", "5")
+	proc := cmd.Process()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := proc.StartContext(ctx); err != nil {
+		t.Skipf("sleep not available: %v", err)
+	}
+	cancel()
+
+	if err := proc.Wait(); err == nil {
+		t.Errorf("expected process to be signalled")
+	}
+}
+
+func TestShutdownEscalatesToKill(t *testing.T) {
+	cmd := New("sleep", "5")
+	proc := cmd.Process()
+	if err := proc.Start(); err != nil {
+		t.Skipf("sleep not available: %v", err)
+	}
+
+	if err := proc.Shutdown(syscall.Signal(0), time.Millisecond); err == nil {
+		t.Errorf("expected process to be killed after grace period elapsed")
+	}
+}
+
+func TestTestCmdSignalAndShutdown(t *testing.T) {
+	cmd := &TestCmd{SignalErr: os.ErrClosed}
+	proc := cmd.Process()
+	if err := proc.Signal(syscall.SIGTERM); err != os.ErrClosed {
+		t.Errorf("want %v got %v", os.ErrClosed, err)
+	}
+
+	tp := proc.(*testProcess)
+	if len(tp.signals) != 1 || tp.signals[0] != syscall.SIGTERM {
+		t.Errorf("unexpected recorded signals: %v", tp.signals)
+	}
+
+	cmd = &TestCmd{ShutdownErr: os.ErrClosed}
+	proc = cmd.Process()
+	if err := proc.Shutdown(syscall.SIGTERM, time.Second); err != os.ErrClosed {
+		t.Errorf("want %v got %v", os.ErrClosed, err)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2019 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestDedupEnv(t *testing.T) {
+	tests := []struct {
+		name            string
+		env             []string
+		caseInsensitive bool
+		want            []string
+	}{
+		{
+			name: "last occurrence wins, keeps position",
+			env:  []string{"k1=v1", "k2=v2", "k1=v3"},
+			want: []string{"k2=v2", "k1=v3"},
+		},
+		{
+			name: "opaque entries pass through untouched",
+			env:  []string{"k1=v1", "opaque", "opaque"},
+			want: []string{"k1=v1", "opaque", "opaque"},
+		},
+		{
+			name:            "case insensitive keeps surviving casing",
+			env:             []string{"Path=a", "PATH=b"},
+			caseInsensitive: true,
+			want:            []string{"PATH=b"},
+		},
+		{
+			name: "windows drive entries are kept as keyed entries",
+			env:  []string{"=C:=C:\\foo", "=C:=C:\\bar"},
+			want: []string{"=C:=C:\\bar"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := DedupEnv(test.env, test.caseInsensitive)
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("want %v got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestCommandEnv(t *testing.T) {
+	command := New("env")
+	command.AppendEnv("CMD_ENV_TEST=hello")
+	if want, got := []string{"CMD_ENV_TEST=hello"}, command.Environ(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v got %v", want, got)
+	}
+
+	proc := command.Process()
+	proc.Env("CMD_ENV_TEST=goodbye")
+
+	stdout := bytes.NewBuffer(nil)
+	proc.Stdout(stdout)
+	if err := proc.Start(); err != nil {
+		t.Skipf("env not available: %v", err)
+	}
+	if err := proc.Wait(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !bytes.Contains(stdout.Bytes(), []byte("CMD_ENV_TEST=goodbye")) {
+		t.Errorf("expected process Env to override Command env, got %q", stdout.String())
+	}
+
+	command.SetEnv([]string{"OTHER=1"})
+	if want, got := []string{"OTHER=1"}, command.Environ(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestTestCmdEnv(t *testing.T) {
+	cmd := &TestCmd{Env: []string{"k1=v1"}}
+	if want, got := []string{"k1=v1"}, cmd.Environ(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v got %v", want, got)
+	}
+
+	cmd.AppendEnv("k2=v2")
+	proc := cmd.Process()
+	proc.Env("k3=v3")
+
+	tp := proc.(*testProcess)
+	if want, got := []string{"k1=v1", "k2=v2", "k3=v3"}, tp.env; !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v got %v", want, got)
+	}
+
+	cmd.SetEnv([]string{"k4=v4"})
+	if want, got := []string{"k4=v4"}, cmd.Environ(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
@@ -0,0 +1,319 @@
+// Copyright 2019 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plugin turns a cmd.Command into a dispatcher for external
+// subcommand binaries, following the convention used by tools such as
+// docker, kubectl, and git: a plugin named "foo" is any executable called
+// "<prefix>-foo" found on $PATH or in one of the Manager's directories.
+// An executable that does not answer the --__plugin-metadata flag with a
+// line of JSON metadata is skipped and is not listed as a plugin
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mh-orange/cmd"
+)
+
+// metadataFlag is passed to every discovered binary to ask it to describe
+// itself.  A well behaved plugin prints a single line of JSON matching
+// PluginInfo to stdout and exits
+const metadataFlag = "--__plugin-metadata"
+
+// metadataTimeout bounds how long scan waits for a candidate binary to
+// respond to metadataFlag, so one misbehaving plugin can't wedge discovery
+const metadataTimeout = 2 * time.Second
+
+// PluginInfo describes a single discovered plugin binary
+type PluginInfo struct {
+	// Name is the plugin name, i.e. the binary's name with the prefix and
+	// separating dash removed
+	Name string `json:"-"`
+
+	// Path is the absolute path to the plugin binary
+	Path string `json:"-"`
+
+	SchemaVersion    string `json:"schemaVersion"`
+	Vendor           string `json:"vendor"`
+	Version          string `json:"version"`
+	ShortDescription string `json:"shortDescription"`
+}
+
+// Manager discovers and dispatches to plugin binaries named
+// "<prefix>-<name>"
+type Manager struct {
+	prefix string
+	dirs   []string
+
+	mu      sync.Mutex
+	once    *sync.Once
+	plugins map[string]PluginInfo
+}
+
+// NewManager creates a Manager that looks for plugins in dirs, in addition
+// to every directory on $PATH
+func NewManager(prefix string, dirs ...string) *Manager {
+	all := append([]string{}, dirs...)
+	all = append(all, filepath.SplitList(os.Getenv("PATH"))...)
+	return &Manager{prefix: prefix, dirs: all, once: &sync.Once{}}
+}
+
+// Refresh forces the plugin listing to be rebuilt the next time it is
+// needed, picking up plugins installed or removed since the Manager was
+// created.  Refresh is safe to call concurrently with List, Lookup, and
+// Dispatch
+func (m *Manager) Refresh() {
+	m.mu.Lock()
+	m.once = &sync.Once{}
+	m.mu.Unlock()
+}
+
+// List returns the metadata for every discovered plugin, sorted by name
+func (m *Manager) List() []PluginInfo {
+	m.scan()
+
+	m.mu.Lock()
+	list := make([]PluginInfo, 0, len(m.plugins))
+	for _, info := range m.plugins {
+		list = append(list, info)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Lookup returns the Command for the named plugin.  If no plugin is found
+// the returned error names the closest known plugin, if any, as a
+// suggestion
+func (m *Manager) Lookup(name string) (cmd.Command, error) {
+	m.scan()
+
+	m.mu.Lock()
+	info, ok := m.plugins[name]
+	var names []string
+	if !ok {
+		names = make([]string, 0, len(m.plugins))
+		for n := range m.plugins {
+			names = append(names, n)
+		}
+	}
+	m.mu.Unlock()
+
+	if ok {
+		return cmd.New(info.Path), nil
+	}
+
+	if alt := suggest(name, names); alt != "" {
+		return nil, fmt.Errorf("plugin: unknown command %q (did you mean %q?)", name, alt)
+	}
+	return nil, fmt.Errorf("plugin: unknown command %q", name)
+}
+
+// Dispatch resolves args[0] to a Command, preferring the builtins map if it
+// contains a matching entry, falling back to a discovered plugin.  It
+// returns a Process with the remaining args appended and stdin/stdout/stderr
+// wired to the parent's, so that the parent CLI can tee its output into
+// logs by calling Stdout/Stderr again before Start
+func (m *Manager) Dispatch(args []string, builtins map[string]cmd.Command) (cmd.Process, error) {
+	if len(args) == 0 {
+		return nil, errors.New("plugin: no subcommand given")
+	}
+
+	name := args[0]
+	command, ok := builtins[name]
+	if !ok {
+		var err error
+		command, err = m.Lookup(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	proc := command.Process()
+	proc.AppendArgs(args[1:]...)
+	proc.Stdin(os.Stdin)
+	proc.Stdout(os.Stdout)
+	proc.Stderr(os.Stderr)
+	return proc, nil
+}
+
+func (m *Manager) scan() {
+	m.mu.Lock()
+	once := m.once
+	m.mu.Unlock()
+
+	once.Do(func() {
+		plugins := map[string]PluginInfo{}
+		seen := map[string]bool{}
+		prefix := m.prefix + "-"
+
+		for _, dir := range m.dirs {
+			if dir == "" || seen[dir] {
+				continue
+			}
+			seen[dir] = true
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				continue
+			}
+
+			for _, entry := range entries {
+				name := entry.Name()
+				if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+					continue
+				}
+
+				info, err := entry.Info()
+				if err != nil || !isExecutable(info.Mode()) {
+					continue
+				}
+
+				pluginName := strings.TrimPrefix(trimExeSuffix(name, runtime.GOOS), prefix)
+				if _, ok := plugins[pluginName]; ok {
+					continue
+				}
+
+				path, err := filepath.Abs(filepath.Join(dir, name))
+				if err != nil {
+					continue
+				}
+
+				meta, err := fetchMetadata(path)
+				if err != nil {
+					continue
+				}
+
+				meta.Name = pluginName
+				meta.Path = path
+				plugins[pluginName] = meta
+			}
+		}
+
+		m.mu.Lock()
+		m.plugins = plugins
+		m.mu.Unlock()
+	})
+}
+
+func fetchMetadata(path string) (PluginInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), metadataTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, path, metadataFlag).Output()
+	if err != nil {
+		return PluginInfo{}, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	if !scanner.Scan() {
+		return PluginInfo{}, fmt.Errorf("plugin: %s produced no metadata", path)
+	}
+
+	var info PluginInfo
+	if err := json.Unmarshal(scanner.Bytes(), &info); err != nil {
+		return PluginInfo{}, fmt.Errorf("plugin: %s produced invalid metadata: %w", path, err)
+	}
+	return info, nil
+}
+
+func isExecutable(mode os.FileMode) bool {
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	return mode&0111 != 0
+}
+
+// trimExeSuffix strips a case-insensitive ".exe" suffix from name when goos
+// is "windows", where plugin binaries are matched by filename including the
+// extension, so that "mycli-foo.exe" resolves to the plugin name "foo"
+// rather than "foo.exe".  goos is taken as a parameter, rather than read
+// from runtime.GOOS directly, so the trimming logic can be unit tested on
+// any platform
+func trimExeSuffix(name, goos string) string {
+	if goos != "windows" {
+		return name
+	}
+	if ext := filepath.Ext(name); strings.EqualFold(ext, ".exe") {
+		return name[:len(name)-len(ext)]
+	}
+	return name
+}
+
+// suggest returns the candidate closest to name, by edit distance, or ""
+// if none of the candidates are a plausible match
+func suggest(name string, candidates []string) string {
+	best := ""
+	bestDist := -1
+	for _, candidate := range candidates {
+		dist := levenshtein(name, candidate)
+		if bestDist == -1 || dist < bestDist {
+			best = candidate
+			bestDist = dist
+		}
+	}
+
+	if bestDist >= 0 && bestDist <= len(name)/2+1 {
+		return best
+	}
+	return ""
+}
+
+func levenshtein(a, b string) int {
+	row := make([]int, len(b)+1)
+	for j := range row {
+		row[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		prev := row[0]
+		row[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			temp := row[j]
+			row[j] = min3(row[j]+1, row[j-1]+1, prev+cost)
+			prev = temp
+		}
+	}
+
+	return row[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,193 @@
+// Copyright 2019 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMain lets the test binary double as the fake plugin executable: when
+// re-invoked with CMD_PLUGIN_TEST_HELPER set, it answers the metadata flag
+// or prints "hello from foo" instead of running the test suite
+func TestMain(m *testing.M) {
+	if os.Getenv("CMD_PLUGIN_TEST_HELPER") == "1" {
+		runHelper()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+func runHelper() {
+	for _, arg := range os.Args[1:] {
+		if arg == metadataFlag {
+			if os.Getenv("CMD_PLUGIN_TEST_HANG") == "1" {
+				time.Sleep(time.Minute)
+			}
+			fmt.Fprintln(os.Stdout, `{"schemaVersion":"1","vendor":"acme","version":"1.0.0","shortDescription":"a test plugin"}`)
+			os.Exit(0)
+		}
+	}
+	fmt.Fprint(os.Stdout, "hello from foo")
+	os.Exit(0)
+}
+
+func installPlugin(t *testing.T, dir, name string) {
+	t.Helper()
+
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(self)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManagerListAndDispatch(t *testing.T) {
+	dir := t.TempDir()
+	installPlugin(t, dir, "mycli-foo")
+
+	os.Setenv("CMD_PLUGIN_TEST_HELPER", "1")
+	defer os.Unsetenv("CMD_PLUGIN_TEST_HELPER")
+
+	mgr := NewManager("mycli", dir)
+
+	list := mgr.List()
+	if len(list) != 1 || list[0].Name != "foo" || list[0].Vendor != "acme" {
+		t.Fatalf("unexpected plugin list: %+v", list)
+	}
+
+	// Dispatch wires the process to the real os.Stdout so a CLI can forward
+	// plugin output to the user; swap it out here so the plugin's output
+	// doesn't get interleaved with the test runner's own
+	realStdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+
+	proc, err := mgr.Dispatch([]string{"foo"}, nil)
+	os.Stdout = realStdout
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	out := bytes.NewBuffer(nil)
+	proc.Stdout(out)
+
+	if err := proc.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := proc.Wait(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	w.Close()
+	r.Close()
+
+	if got := out.String(); got != "hello from foo" {
+		t.Errorf("want %q got %q", "hello from foo", got)
+	}
+}
+
+func TestFetchMetadataTimesOutOnHungPlugin(t *testing.T) {
+	dir := t.TempDir()
+	installPlugin(t, dir, "mycli-hung")
+
+	os.Setenv("CMD_PLUGIN_TEST_HELPER", "1")
+	os.Setenv("CMD_PLUGIN_TEST_HANG", "1")
+	defer os.Unsetenv("CMD_PLUGIN_TEST_HELPER")
+	defer os.Unsetenv("CMD_PLUGIN_TEST_HANG")
+
+	if _, err := fetchMetadata(filepath.Join(dir, "mycli-hung")); err == nil {
+		t.Fatal("expected a timeout error from a hanging plugin")
+	}
+}
+
+func TestManagerRefreshConcurrentWithList(t *testing.T) {
+	dir := t.TempDir()
+	installPlugin(t, dir, "mycli-foo")
+
+	os.Setenv("CMD_PLUGIN_TEST_HELPER", "1")
+	defer os.Unsetenv("CMD_PLUGIN_TEST_HELPER")
+
+	mgr := NewManager("mycli", dir)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			mgr.List()
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		mgr.Refresh()
+	}
+	<-done
+}
+
+func TestManagerLookupSuggestion(t *testing.T) {
+	dir := t.TempDir()
+	installPlugin(t, dir, "mycli-foo")
+
+	os.Setenv("CMD_PLUGIN_TEST_HELPER", "1")
+	defer os.Unsetenv("CMD_PLUGIN_TEST_HELPER")
+
+	mgr := NewManager("mycli", dir)
+
+	_, err := mgr.Lookup("fo")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if !strings.Contains(err.Error(), `"foo"`) {
+		t.Errorf("expected suggestion for %q in error, got %v", "foo", err)
+	}
+}
+
+func TestTrimExeSuffix(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		goos string
+		want string
+	}{
+		{name: "windows strips .exe", in: "mycli-foo.exe", goos: "windows", want: "mycli-foo"},
+		{name: "windows strips .exe case-insensitively", in: "mycli-foo.EXE", goos: "windows", want: "mycli-foo"},
+		{name: "windows leaves extensionless names alone", in: "mycli-foo", goos: "windows", want: "mycli-foo"},
+		{name: "non-windows leaves .exe alone", in: "mycli-foo.exe", goos: "linux", want: "mycli-foo.exe"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := trimExeSuffix(test.in, test.goos); got != test.want {
+				t.Errorf("trimExeSuffix(%q, %q) = %q, want %q", test.in, test.goos, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2019 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Progress describes how far a unit of work has advanced, expressed as a
+// fraction of Current out of Total.  Total is zero when the total amount
+// of work is not yet known
+type Progress struct {
+	Current int64 `json:"current"`
+	Total   int64 `json:"total"`
+}
+
+// ProgressEvent is a single line of structured progress emitted by a child
+// process.  The shape is modeled on the vertex/status/log protocol used by
+// tools such as docker build: each event belongs to a Vertex of work
+// identified by ID, and carries either a human readable Status, a Progress
+// update, raw vendor specific data in Aux, or a terminal Error
+type ProgressEvent struct {
+	ID        string          `json:"id"`
+	Vertex    string          `json:"vertex"`
+	Stream    string          `json:"stream"`
+	Timestamp time.Time       `json:"timestamp"`
+	Status    string          `json:"status"`
+	Progress  Progress        `json:"progress"`
+	Aux       json.RawMessage `json:"aux,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// ProgressStdout subscribes to proc's Stdout, treating it as a stream of
+// newline delimited JSON encoded ProgressEvents, and returns a channel that
+// receives each decoded event.  The returned channel is closed when the
+// underlying stdout is closed.  Lines that fail to decode as a ProgressEvent
+// are dropped.  Because ProgressStdout registers itself the same way any
+// other Stdout subscriber would, callers are free to also call proc.Stdout
+// to keep receiving the raw bytes; decoded events are queued internally, so
+// a caller that is slow to range over the returned channel - or never reads
+// it at all - cannot stall that other subscriber or proc.Wait.  The queue is
+// unbounded, so a caller that intends to ignore the channel should still
+// drain it (or not call ProgressStdout) rather than let it grow forever
+func ProgressStdout(proc Process) <-chan ProgressEvent {
+	decoded := make(chan ProgressEvent)
+	reader, writer := io.Pipe()
+	proc.Stdout(writer)
+
+	go func() {
+		defer close(decoded)
+		buffered := bufio.NewReader(reader)
+		for {
+			line, err := buffered.ReadBytes('\n')
+
+			var event ProgressEvent
+			if json.Unmarshal(line, &event) == nil {
+				decoded <- event
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return queueEvents(decoded)
+}
+
+// queueEvents relays events from in to the returned channel through an
+// unbounded in-memory queue, so that sending to in never blocks waiting for
+// a reader of the returned channel
+func queueEvents(in <-chan ProgressEvent) <-chan ProgressEvent {
+	out := make(chan ProgressEvent)
+
+	go func() {
+		defer close(out)
+
+		var queue []ProgressEvent
+		for {
+			if len(queue) == 0 {
+				event, ok := <-in
+				if !ok {
+					return
+				}
+				queue = append(queue, event)
+				continue
+			}
+
+			select {
+			case event, ok := <-in:
+				if !ok {
+					for _, event := range queue {
+						out <- event
+					}
+					return
+				}
+				queue = append(queue, event)
+			case out <- queue[0]:
+				queue = queue[1:]
+			}
+		}
+	}()
+
+	return out
+}
+
+// RenderProgress reads events until the channel is closed, drawing a
+// terminal friendly, multi-line status that groups events by ID.  When w is
+// a terminal, each redraw moves the cursor back up over the previously
+// drawn lines so the status updates in place; otherwise each event is
+// simply appended as its own line
+func RenderProgress(w io.Writer, events <-chan ProgressEvent) {
+	order := []string{}
+	status := map[string]ProgressEvent{}
+
+	interactive := false
+	if f, ok := w.(*os.File); ok {
+		interactive = isTerminal(f)
+	}
+
+	lines := 0
+	for event := range events {
+		if _, ok := status[event.ID]; !ok {
+			order = append(order, event.ID)
+		}
+		status[event.ID] = event
+
+		if interactive {
+			if lines > 0 {
+				fmt.Fprintf(w, "\033[%dA", lines)
+			}
+			for _, id := range order {
+				fmt.Fprintf(w, "\033[2K%s\n", formatProgress(status[id]))
+			}
+			lines = len(order)
+		} else {
+			fmt.Fprintln(w, formatProgress(event))
+		}
+	}
+}
+
+func formatProgress(event ProgressEvent) string {
+	switch {
+	case event.Error != "":
+		return fmt.Sprintf("%s: error: %s", event.Vertex, event.Error)
+	case event.Progress.Total > 0:
+		return fmt.Sprintf("%s: %s (%d/%d)", event.Vertex, event.Status, event.Progress.Current, event.Progress.Total)
+	default:
+		return fmt.Sprintf("%s: %s", event.Vertex, event.Status)
+	}
+}
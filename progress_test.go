@@ -0,0 +1,102 @@
+// Copyright 2019 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestProgressStdout(t *testing.T) {
+	wantStdout := `{"id":"1","vertex":"build","status":"downloading","progress":{"current":1,"total":2}}
+{"id":"1","vertex":"build","status":"done"}
+not json, should be dropped
+`
+	cmd := &TestCmd{Stdout: []byte(wantStdout)}
+	proc := cmd.Process()
+	events := ProgressStdout(proc)
+
+	err := proc.Start()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got := []ProgressEvent{}
+	for event := range events {
+		got = append(got, event)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("want 2 events got %d", len(got))
+	}
+
+	if got[0].Status != "downloading" || got[0].Progress.Current != 1 || got[0].Progress.Total != 2 {
+		t.Errorf("unexpected first event: %+v", got[0])
+	}
+
+	if got[1].Status != "done" {
+		t.Errorf("unexpected second event: %+v", got[1])
+	}
+}
+
+func TestProgressStdoutDoesNotBlockOtherSubscribers(t *testing.T) {
+	wantStdout := `{"id":"1","vertex":"build","status":"downloading"}
+{"id":"1","vertex":"build","status":"done"}
+`
+	cmd := &TestCmd{Stdout: []byte(wantStdout)}
+	proc := cmd.Process()
+
+	// Subscribe to the raw bytes as well as the decoded events, per the
+	// doc comment, and never range over the returned event channel
+	raw := bytes.NewBuffer(nil)
+	proc.Stdout(raw)
+	ProgressStdout(proc)
+
+	if err := proc.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		proc.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("proc.Wait() blocked: an undrained ProgressStdout channel stalled a sibling subscriber")
+	}
+
+	if got := raw.String(); got != wantStdout {
+		t.Errorf("want %q got %q", wantStdout, got)
+	}
+}
+
+func TestRenderProgress(t *testing.T) {
+	events := make(chan ProgressEvent, 2)
+	events <- ProgressEvent{ID: "1", Vertex: "build", Status: "downloading"}
+	events <- ProgressEvent{ID: "1", Vertex: "build", Status: "done"}
+	close(events)
+
+	buf := bytes.NewBuffer(nil)
+	RenderProgress(buf, events)
+
+	want := "build: downloading\nbuild: done\n"
+	if got := buf.String(); got != want {
+		t.Errorf("want %q got %q", want, got)
+	}
+}
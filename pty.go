@@ -0,0 +1,85 @@
+// Copyright 2019 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+)
+
+// ErrPTYNotSupported is returned by NewPTY on platforms without a pty
+// implementation
+var ErrPTYNotSupported = errors.New("cmd: pty allocation is not supported on this platform")
+
+// PTY is a pseudo-terminal pair.  Master is the parent facing end of the
+// pty; Slave is handed to the child process in place of the usual stdio
+// pipes so that the child sees a real terminal
+type PTY struct {
+	Master *os.File
+	Slave  *os.File
+}
+
+// Close closes both ends of the pty
+func (p *PTY) Close() error {
+	err := p.Master.Close()
+	if slaveErr := p.Slave.Close(); err == nil {
+		err = slaveErr
+	}
+	return err
+}
+
+// Resize sets the pty's window size, as seen by the child through
+// TIOCGWINSZ
+func (p *PTY) Resize(rows, cols uint16) error {
+	return setWinsize(p.Master, rows, cols)
+}
+
+// WatchResize resizes pty to match the size reported for win (typically
+// os.Stdout) every time the process receives SIGWINCH, and once immediately
+// so the child starts out with the correct size.  The returned function
+// stops watching and does not return until the watching goroutine has
+// exited, so it is safe to close pty and win once stop returns
+func WatchResize(pty *PTY, win *os.File) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	notifyResize(ch)
+
+	resize := func() {
+		if rows, cols, err := getWinsize(win); err == nil {
+			pty.Resize(rows, cols)
+		}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		resize()
+		for {
+			select {
+			case <-ch:
+				resize()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(ch)
+		close(done)
+		<-stopped
+	}
+}
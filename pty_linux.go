@@ -0,0 +1,105 @@
+// Copyright 2019 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// NewPTY opens a new pseudo-terminal pair via /dev/ptmx.  This is a Linux
+// only implementation: it unlocks and names the slave with the
+// TIOCSPTLCK/TIOCGPTN ioctls, which have no BSD/Darwin equivalent
+func NewPTY() (*PTY, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := unlockpt(master); err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	name, err := ptsname(master)
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	slave, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	return &PTY{Master: master, Slave: slave}, nil
+}
+
+func ptsname(f *os.File) (string, error) {
+	var n uint32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n)))
+	if errno != 0 {
+		return "", errno
+	}
+	return fmt.Sprintf("/dev/pts/%d", n), nil
+}
+
+func unlockpt(f *os.File) error {
+	var unlock int32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+type winsize struct {
+	rows, cols, xpixel, ypixel uint16
+}
+
+func setWinsize(f *os.File, rows, cols uint16) error {
+	ws := winsize{rows: rows, cols: cols}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func getWinsize(f *os.File) (rows, cols uint16, err error) {
+	var ws winsize
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 {
+		return 0, 0, errno
+	}
+	return ws.rows, ws.cols, nil
+}
+
+func notifyResize(ch chan<- os.Signal) {
+	signal.Notify(ch, syscall.SIGWINCH)
+}
+
+// setCtty marks attr so the child is started in its own session with its
+// stdin, at index ttyFdIndex among the child's inherited descriptors, as
+// its controlling terminal
+func setCtty(attr *syscall.SysProcAttr, ttyFdIndex int) {
+	attr.Setsid = true
+	attr.Setctty = true
+	attr.Ctty = ttyFdIndex
+}
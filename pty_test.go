@@ -0,0 +1,101 @@
+// Copyright 2019 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestProcessTty(t *testing.T) {
+	pty, err := NewPTY()
+	if err != nil {
+		t.Skipf("pty not supported: %v", err)
+	}
+
+	cmd := New("echo", "hello from the pty")
+	proc := cmd.Process()
+	if err := proc.Tty(pty); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	stdout, w := io.Pipe()
+	proc.Stdout(w)
+
+	if err := proc.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if want := "hello from the pty\r\n"; line != want {
+		t.Errorf("want %q got %q", want, line)
+	}
+
+	if err := proc.Wait(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	pty.Master.Close()
+}
+
+func TestWatchResize(t *testing.T) {
+	pty, err := NewPTY()
+	if err != nil {
+		t.Skipf("pty not supported: %v", err)
+	}
+	defer pty.Close()
+
+	win, err := NewPTY()
+	if err != nil {
+		t.Skipf("pty not supported: %v", err)
+	}
+	defer win.Close()
+
+	if err := setWinsize(win.Master, 42, 100); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	stop := WatchResize(pty, win.Master)
+	defer stop()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		rows, cols, err := getWinsize(pty.Master)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if rows == 42 && cols == 100 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("want 42x100 got %dx%d", rows, cols)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestProcessResizeWithoutTty(t *testing.T) {
+	cmd := New("")
+	proc := cmd.Process()
+	if err := proc.Resize(24, 80); err != errNoTty {
+		t.Errorf("want %v got %v", errNoTty, err)
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2019 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"syscall"
+)
+
+// NewPTY is not implemented on windows; allocating a console requires
+// ConPTY support that this package does not yet provide
+func NewPTY() (*PTY, error) {
+	return nil, ErrPTYNotSupported
+}
+
+func setWinsize(f *os.File, rows, cols uint16) error {
+	return ErrPTYNotSupported
+}
+
+func getWinsize(f *os.File) (rows, cols uint16, err error) {
+	return 0, 0, ErrPTYNotSupported
+}
+
+func notifyResize(ch chan<- os.Signal) {}
+
+func setCtty(attr *syscall.SysProcAttr, ttyFdIndex int) {}
@@ -0,0 +1,23 @@
+// Copyright 2019 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import "os"
+
+// defaultShutdownSignal is sent to the process when a context passed to
+// StartContext is cancelled, before the grace period begins.  Windows has
+// no SIGTERM equivalent that os.Process.Signal can deliver, so the process
+// is killed outright
+var defaultShutdownSignal os.Signal = os.Kill
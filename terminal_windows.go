@@ -0,0 +1,27 @@
+// Copyright 2019 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"syscall"
+)
+
+// isTerminal reports whether f is attached to a console
+func isTerminal(f *os.File) bool {
+	var mode uint32
+	err := syscall.GetConsoleMode(syscall.Handle(f.Fd()), &mode)
+	return err == nil
+}